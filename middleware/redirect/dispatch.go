@@ -0,0 +1,193 @@
+package redirect
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// dispatcher is a precompiled index over a rule set, grouping literal
+// (non-regex) rules by scheme and host. An exact FromPath match is
+// found with one map lookup. The prefix tier walks a bucket's prefix
+// rules longest first and stops once no remaining rule can beat the
+// best match, so a request that no prefix rule applies to still checks
+// every prefix rule in its buckets. Catch-all and FromRegex rules are
+// scanned in order.
+//
+// When more than one rule could apply to a request, the dispatcher
+// resolves the conflict with a fixed precedence, regardless of the
+// rules' original order:
+//
+//  1. an exact FromPath match
+//  2. the longest FromPath that is a path-segment prefix of the request
+//  3. a scheme/host catch-all rule (FromPath "" or "/")
+//  4. FromRegex rules, tried in their original order
+//
+// This differs from a plain linear scan, which always honors
+// whichever rule came first in Rules; that behavior is still
+// available by using a Redirect built without NewRedirect.
+type dispatcher struct {
+	buckets map[hostSchemeKey]*pathIndex
+	regexes []regexRule
+}
+
+// regexRule pairs a FromRegex rule with its pattern, compiled once by
+// newDispatcher instead of on every request.
+type regexRule struct {
+	rule *Rule
+	re   *regexp.Regexp
+}
+
+// hostSchemeKey buckets rules by scheme and hostname (port excluded;
+// a rule's optional port is checked against the request separately,
+// via hostMatches, once a candidate is found).
+type hostSchemeKey struct {
+	scheme string
+	host   string // "" means the rule's FromHost was unset (matches any host)
+}
+
+// pathIndex holds the literal-path rules that fall into one
+// hostSchemeKey bucket.
+type pathIndex struct {
+	exact    map[string][]*Rule // FromPath -> candidates, in Rules order
+	prefixes []*Rule            // FromPath not "" or "/", sorted by descending length
+	catchAll []*Rule            // FromPath "" or "/", in Rules order
+}
+
+// newDispatcher builds a dispatcher over rules. It does not mutate
+// rules; rules must outlive the dispatcher, since it holds pointers
+// into the slice.
+func newDispatcher(rules []Rule) *dispatcher {
+	d := &dispatcher{buckets: make(map[hostSchemeKey]*pathIndex)}
+
+	for i := range rules {
+		rule := &rules[i]
+		if rule.FromRegex != "" {
+			re, err := regexp.Compile(rule.FromRegex)
+			if err != nil {
+				continue // invalid pattern never matches, same as Rule.match
+			}
+			d.regexes = append(d.regexes, regexRule{rule: rule, re: re})
+			continue
+		}
+
+		scheme := rule.FromScheme
+		if scheme == "" {
+			scheme = "http"
+		}
+		host, _ := splitHostPort(rule.FromHost)
+		key := hostSchemeKey{scheme: scheme, host: host}
+
+		pi, ok := d.buckets[key]
+		if !ok {
+			pi = &pathIndex{exact: make(map[string][]*Rule)}
+			d.buckets[key] = pi
+		}
+
+		if rule.FromPath == "" || rule.FromPath == "/" {
+			pi.catchAll = append(pi.catchAll, rule)
+			continue
+		}
+		pi.exact[rule.FromPath] = append(pi.exact[rule.FromPath], rule)
+		pi.prefixes = append(pi.prefixes, rule)
+	}
+
+	for _, pi := range d.buckets {
+		sort.SliceStable(pi.prefixes, func(i, j int) bool {
+			return len(pi.prefixes[i].FromPath) > len(pi.prefixes[j].FromPath)
+		})
+	}
+
+	return d
+}
+
+// lookup finds the rule that should handle r, if any, and returns it
+// along with its resolved redirect target.
+func (d *dispatcher) lookup(r *http.Request) (*Rule, string) {
+	scheme := reqScheme(r)
+	hostname, _ := splitHostPort(r.Host)
+
+	keys := []hostSchemeKey{{scheme: scheme, host: hostname}}
+	if hostname != "" {
+		keys = append(keys, hostSchemeKey{scheme: scheme, host: ""})
+	}
+
+	// Tier 1: exact path match.
+	for _, key := range keys {
+		pi, ok := d.buckets[key]
+		if !ok {
+			continue
+		}
+		for _, rule := range pi.exact[r.URL.Path] {
+			if !hostMatches(rule.FromHost, r.Host) {
+				continue
+			}
+			return rule, rule.resolveTo(r)
+		}
+	}
+
+	// Tier 2: longest path-segment prefix.
+	var best *Rule
+	for _, key := range keys {
+		pi, ok := d.buckets[key]
+		if !ok {
+			continue
+		}
+		for _, rule := range pi.prefixes {
+			if best != nil && len(rule.FromPath) <= len(best.FromPath) {
+				break // sorted descending; nothing further can beat best
+			}
+			if !hostMatches(rule.FromHost, r.Host) || !pathHasPrefix(r.URL.Path, rule.FromPath) {
+				continue
+			}
+			best = rule
+		}
+	}
+	if best != nil {
+		return best, best.resolveTo(r)
+	}
+
+	// Tier 3: scheme/host catch-all.
+	for _, key := range keys {
+		pi, ok := d.buckets[key]
+		if !ok {
+			continue
+		}
+		for _, rule := range pi.catchAll {
+			if !hostMatches(rule.FromHost, r.Host) {
+				continue
+			}
+			return rule, rule.resolveTo(r)
+		}
+	}
+
+	// Tier 4: regex rules, in their original order, against patterns
+	// precompiled once by newDispatcher.
+	for _, rr := range d.regexes {
+		rule := rr.rule
+		fromScheme := rule.FromScheme
+		if fromScheme == "" {
+			fromScheme = "http"
+		}
+		if fromScheme != scheme || !hostMatches(rule.FromHost, r.Host) {
+			continue
+		}
+		if to, matched := rule.matchRegex(rr.re, r); matched {
+			return rule, to
+		}
+	}
+
+	return nil, ""
+}
+
+// pathHasPrefix reports whether prefix is a path-segment prefix of
+// path: prefix must match literally, and must end exactly at a "/"
+// boundary (or the end of path), so that FromPath "/a" matches "/a"
+// and "/a/b" but not "/ab".
+func pathHasPrefix(path, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
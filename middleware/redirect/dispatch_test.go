@@ -0,0 +1,197 @@
+package redirect
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+func TestDispatcherPrecedence(t *testing.T) {
+	rules := []Rule{
+		{FromPath: "/", To: "/catch-all{path}", Code: http.StatusMovedPermanently},
+		{FromPath: "/a", To: "/prefix-a{path}", Code: http.StatusMovedPermanently},
+		{FromPath: "/a/b", To: "/prefix-ab{path}", Code: http.StatusMovedPermanently},
+	}
+	re := NewRedirect(middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return 0, nil
+	}), rules)
+
+	for i, test := range []struct {
+		path             string
+		expectedLocation string
+	}{
+		{"/a/b", "/prefix-ab/a/b"},     // exact match beats both prefixes
+		{"/a/b/x", "/prefix-ab/a/b/x"}, // longest applicable prefix ("/a/b") beats the shorter one ("/a")
+		{"/a/x", "/prefix-a/a/x"},      // only the shorter prefix ("/a") applies here
+		{"/z", "/catch-all/z"},         // nothing but the catch-all applies
+	} {
+		req, err := http.NewRequest("GET", "http://localhost"+test.path, nil)
+		if err != nil {
+			t.Fatalf("Test %d: %v", i, err)
+		}
+		rec := httptest.NewRecorder()
+		re.ServeHTTP(rec, req)
+		if got := rec.Header().Get("Location"); got != test.expectedLocation {
+			t.Errorf("Test %d (%s): expected Location %q, got %q", i, test.path, test.expectedLocation, got)
+		}
+	}
+}
+
+func TestDispatcherRegexFallback(t *testing.T) {
+	rules := []Rule{
+		{FromPath: "/other", To: "/literal", Code: http.StatusMovedPermanently},
+		{FromRegex: `^/special/(.*)$`, To: "/regex/$1", Code: http.StatusMovedPermanently},
+	}
+	re := NewRedirect(middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return 0, nil
+	}), rules)
+
+	req, _ := http.NewRequest("GET", "http://localhost/special/thing", nil)
+	rec := httptest.NewRecorder()
+	re.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Location"); got != "/regex/thing" {
+		t.Errorf("Expected Location %q, got %q", "/regex/thing", got)
+	}
+}
+
+// TestDispatcherMatchesLinearScanOnSimpleRules checks that the two
+// constructors agree on requests a non-catch-all FromPath rule
+// actually applies to (exact matches and misses).
+func TestDispatcherMatchesLinearScanOnSimpleRules(t *testing.T) {
+	rules := []Rule{
+		{FromPath: "/from", To: "/to", Code: http.StatusMovedPermanently},
+		{FromScheme: "http", FromPath: "/scheme", To: "https://localhost/scheme", Code: http.StatusMovedPermanently},
+	}
+
+	linear := Redirect{Rules: rules}
+	indexed := NewRedirect(nil, rules)
+
+	for _, path := range []string{"/from", "/scheme", "/nope"} {
+		req, _ := http.NewRequest("GET", "http://localhost"+path, nil)
+		linRec := httptest.NewRecorder()
+		var nextCalled bool
+		linear.Next = middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			nextCalled = true
+			return 0, nil
+		})
+		linear.ServeHTTP(linRec, req)
+
+		req2, _ := http.NewRequest("GET", "http://localhost"+path, nil)
+		idxRec := httptest.NewRecorder()
+		indexed.Next = middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return 0, nil
+		})
+		indexed.ServeHTTP(idxRec, req2)
+
+		if linRec.Header().Get("Location") != idxRec.Header().Get("Location") {
+			t.Errorf("Path %s: linear scan gave Location %q but indexed dispatcher gave %q",
+				path, linRec.Header().Get("Location"), idxRec.Header().Get("Location"))
+		}
+		_ = nextCalled
+	}
+}
+
+// TestDispatcherPrefixDivergesFromLinearScan pins down a deliberate
+// difference between the two constructors: a sub-path of a non-catch-all
+// FromPath is a prefix match for the indexed dispatcher (tier 2 of
+// dispatcher.lookup) but not for a plain linear scan, which requires an
+// exact FromPath match (see Rule.match).
+func TestDispatcherPrefixDivergesFromLinearScan(t *testing.T) {
+	rules := []Rule{
+		{FromPath: "/from", To: "/to", Code: http.StatusMovedPermanently},
+	}
+
+	linear := Redirect{
+		Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return 0, nil
+		}),
+		Rules: rules,
+	}
+	indexed := NewRedirect(middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return 0, nil
+	}), rules)
+
+	req, _ := http.NewRequest("GET", "http://localhost/from/extra", nil)
+	linRec := httptest.NewRecorder()
+	linear.ServeHTTP(linRec, req)
+	if got := linRec.Header().Get("Location"); got != "" {
+		t.Errorf("linear scan: expected /from/extra to fall through to Next (no exact match), got Location %q", got)
+	}
+
+	req2, _ := http.NewRequest("GET", "http://localhost/from/extra", nil)
+	idxRec := httptest.NewRecorder()
+	indexed.ServeHTTP(idxRec, req2)
+	if got := idxRec.Header().Get("Location"); got != "/to" {
+		t.Errorf("indexed dispatcher: expected /from/extra to match the /from prefix rule and redirect to /to, got Location %q", got)
+	}
+}
+
+func makeBenchRules(n int) []Rule {
+	rules := make([]Rule, n)
+	for i := 0; i < n; i++ {
+		rules[i] = Rule{FromPath: fmt.Sprintf("/path/%d", i), To: fmt.Sprintf("/dest/%d", i), Code: http.StatusMovedPermanently}
+	}
+	return rules
+}
+
+func makeBenchRegexRules(n int) []Rule {
+	rules := make([]Rule, n)
+	for i := 0; i < n; i++ {
+		rules[i] = Rule{FromRegex: fmt.Sprintf(`^/path/%d/(.*)$`, i), To: "/dest/$1", Code: http.StatusMovedPermanently}
+	}
+	return rules
+}
+
+func BenchmarkRedirectDispatch(b *testing.B) {
+	rules := makeBenchRules(1000)
+	req, _ := http.NewRequest("GET", "http://localhost/path/999", nil)
+	next := middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return 0, nil
+	})
+
+	b.Run("linear", func(b *testing.B) {
+		re := Redirect{Next: next, Rules: rules}
+		rec := httptest.NewRecorder()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			re.ServeHTTP(rec, req)
+		}
+	})
+
+	b.Run("indexed", func(b *testing.B) {
+		re := NewRedirect(next, rules)
+		rec := httptest.NewRecorder()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			re.ServeHTTP(rec, req)
+		}
+	})
+
+	// Regex rules: the indexed dispatcher precompiles these once in
+	// newDispatcher, while the linear scan recompiles the matching
+	// pattern on every request (see Rule.match).
+	regexRules := makeBenchRegexRules(1000)
+	regexReq, _ := http.NewRequest("GET", "http://localhost/path/999/extra", nil)
+
+	b.Run("linear-regex", func(b *testing.B) {
+		re := Redirect{Next: next, Rules: regexRules}
+		rec := httptest.NewRecorder()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			re.ServeHTTP(rec, regexReq)
+		}
+	})
+
+	b.Run("indexed-regex", func(b *testing.B) {
+		re := NewRedirect(next, regexRules)
+		rec := httptest.NewRecorder()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			re.ServeHTTP(rec, regexReq)
+		}
+	})
+}
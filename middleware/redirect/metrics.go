@@ -0,0 +1,49 @@
+package redirect
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// redirectsTotal counts the redirects served by this middleware,
+// partitioned by redirect type ("http", "meta", or "proxy" for
+// requests served in ModeProxy), response status code, and the rule
+// that matched.
+var redirectsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "caddy",
+	Subsystem: "redirect",
+	Name:      "redirects_total",
+	Help:      "Count of redirects served, by type, status code, and matched rule.",
+}, []string{"type", "code", "rule"})
+
+// defaultRegisterOnce guards registration against prometheus.DefaultRegisterer,
+// so that calling MustRegister(nil) more than once (e.g. from independent
+// setup paths, or repeatedly in tests) doesn't panic on a duplicate
+// registration of the same collector.
+var defaultRegisterOnce sync.Once
+
+// MustRegister registers the redirect middleware's metrics with reg.
+// If reg is nil, the global prometheus.DefaultRegisterer is used
+// instead. Call this once during setup before serving traffic.
+func MustRegister(reg prometheus.Registerer) {
+	if reg == nil {
+		defaultRegisterOnce.Do(func() {
+			prometheus.DefaultRegisterer.MustRegister(redirectsTotal)
+		})
+		return
+	}
+	reg.MustRegister(redirectsTotal)
+}
+
+// ruleID returns the label value identifying rule in redirectsTotal.
+func ruleID(rule Rule) string {
+	switch {
+	case rule.FromRegex != "":
+		return rule.FromRegex
+	case rule.FromHost != "":
+		return rule.FromHost + rule.FromPath
+	default:
+		return rule.FromPath
+	}
+}
@@ -0,0 +1,87 @@
+package redirect
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsIncrementOnRedirect(t *testing.T) {
+	redirectsTotal.Reset()
+
+	re := Redirect{
+		Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return 0, nil
+		}),
+		Rules: []Rule{
+			{FromPath: "/a", To: "/b", Code: http.StatusMovedPermanently},
+			{FromPath: "/meta", To: "/c", Meta: true},
+		},
+	}
+
+	req, _ := http.NewRequest("GET", "http://localhost/a", nil)
+	re.ServeHTTP(httptest.NewRecorder(), req)
+
+	req, _ = http.NewRequest("GET", "http://localhost/meta", nil)
+	re.ServeHTTP(httptest.NewRecorder(), req)
+
+	if n := testutil.CollectAndCount(redirectsTotal); n != 2 {
+		t.Errorf("Expected 2 distinct label combinations to be recorded, got %d", n)
+	}
+}
+
+func TestMetricsNotIncrementedOnNext(t *testing.T) {
+	redirectsTotal.Reset()
+
+	re := Redirect{
+		Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return 0, nil
+		}),
+		Rules: []Rule{
+			{FromPath: "/a", To: "/b", Code: http.StatusMovedPermanently},
+		},
+	}
+
+	req, _ := http.NewRequest("GET", "http://localhost/does-not-match", nil)
+	re.ServeHTTP(httptest.NewRecorder(), req)
+
+	if n := testutil.CollectAndCount(redirectsTotal); n != 0 {
+		t.Errorf("Expected no metrics to be recorded when Next is called through, got %d", n)
+	}
+}
+
+func TestMustRegisterCustomRegisterer(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	MustRegister(reg)
+
+	redirectsTotal.Reset()
+	redirectsTotal.WithLabelValues("http", "301", "/a").Inc()
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather failed: %v", err)
+	}
+	var found bool
+	for _, mf := range mfs {
+		if mf.GetName() == "caddy_redirect_redirects_total" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Expected redirectsTotal to be gatherable from the registerer passed to MustRegister")
+	}
+}
+
+func TestMustRegisterDefaultRegistererNoPanicOnReuse(t *testing.T) {
+	defer func() {
+		if p := recover(); p != nil {
+			t.Fatalf("MustRegister(nil) panicked: %v", p)
+		}
+	}()
+	MustRegister(nil)
+	MustRegister(nil) // must not panic registering the same collector twice
+}
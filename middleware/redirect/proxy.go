@@ -0,0 +1,103 @@
+package redirect
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync/atomic"
+)
+
+// proxyEndpoints returns the upstream base URLs for a ModeProxy rule,
+// falling back to To as a single upstream when Upstreams isn't set.
+func (rule *Rule) proxyEndpoints() []string {
+	if len(rule.Upstreams) > 0 {
+		return rule.Upstreams
+	}
+	if rule.To != "" {
+		return []string{rule.To}
+	}
+	return nil
+}
+
+// serveProxy reverse-proxies r to one of rule's upstreams, starting
+// from the next upstream in round-robin order and retrying later
+// upstreams on a dial error or 5xx response. It writes the final
+// response to w and returns the status code served, which is
+// StatusServiceUnavailable if every upstream failed.
+func (rule *Rule) serveProxy(w http.ResponseWriter, r *http.Request) int {
+	endpoints := rule.proxyEndpoints()
+	if len(endpoints) == 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return http.StatusServiceUnavailable
+	}
+
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		body, _ = ioutil.ReadAll(r.Body)
+		r.Body.Close()
+	}
+
+	start := int(atomic.AddUint32(&rule.rrCounter, 1)-1) % len(endpoints)
+
+	for i := 0; i < len(endpoints); i++ {
+		target, err := url.Parse(endpoints[(start+i)%len(endpoints)])
+		if err != nil {
+			continue
+		}
+
+		if body != nil {
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+
+		var upstreamErr bool
+		proxy := httputil.NewSingleHostReverseProxy(target)
+		proxy.ErrorHandler = func(http.ResponseWriter, *http.Request, error) {
+			upstreamErr = true
+		}
+
+		buf := newBufferedResponse()
+		proxy.ServeHTTP(buf, r)
+
+		if upstreamErr || buf.status >= http.StatusInternalServerError {
+			continue
+		}
+
+		buf.copyTo(w)
+		return buf.status
+	}
+
+	w.WriteHeader(http.StatusServiceUnavailable)
+	return http.StatusServiceUnavailable
+}
+
+// bufferedResponse buffers a response from an upstream so it can be
+// inspected (and discarded, on failure) before committing it to the
+// real ResponseWriter.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newBufferedResponse() *bufferedResponse {
+	return &bufferedResponse{header: make(http.Header), status: http.StatusOK}
+}
+
+func (b *bufferedResponse) Header() http.Header { return b.header }
+
+func (b *bufferedResponse) Write(p []byte) (int, error) { return b.body.Write(p) }
+
+func (b *bufferedResponse) WriteHeader(status int) { b.status = status }
+
+func (b *bufferedResponse) copyTo(w http.ResponseWriter) {
+	header := w.Header()
+	for k, vv := range b.header {
+		for _, v := range vv {
+			header.Add(k, v)
+		}
+	}
+	w.WriteHeader(b.status)
+	w.Write(b.body.Bytes())
+}
@@ -0,0 +1,95 @@
+package redirect
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+func TestProxyRoundRobin(t *testing.T) {
+	var hits [2]int
+	upstreams := make([]*httptest.Server, 2)
+	for i := range upstreams {
+		i := i
+		upstreams[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits[i]++
+			fmt.Fprintf(w, "upstream-%d", i)
+		}))
+		defer upstreams[i].Close()
+	}
+
+	re := Redirect{
+		Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return 0, nil
+		}),
+		Rules: []Rule{
+			{FromPath: "/a", Mode: ModeProxy, Upstreams: []string{upstreams[0].URL, upstreams[1].URL}},
+		},
+	}
+
+	for i := 0; i < 4; i++ {
+		req, _ := http.NewRequest("GET", "http://localhost/a", nil)
+		rec := httptest.NewRecorder()
+		re.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Request %d: expected 200, got %d", i, rec.Code)
+		}
+	}
+
+	if hits[0] != 2 || hits[1] != 2 {
+		t.Errorf("Expected requests split evenly across upstreams, got %v", hits)
+	}
+}
+
+func TestProxyRetryOnFailingEndpoint(t *testing.T) {
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer bad.Close()
+
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer good.Close()
+
+	re := Redirect{
+		Rules: []Rule{
+			{FromPath: "/a", Mode: ModeProxy, Upstreams: []string{bad.URL, good.URL}},
+		},
+	}
+
+	req, _ := http.NewRequest("GET", "http://localhost/a", nil)
+	rec := httptest.NewRecorder()
+	re.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 after retrying the next upstream, got %d", rec.Code)
+	}
+	if rec.Body.String() != "ok" {
+		t.Errorf("Expected response body %q, got %q", "ok", rec.Body.String())
+	}
+}
+
+func TestProxyTotalOutage(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	down.Close() // close immediately so dialing it fails
+
+	re := Redirect{
+		Rules: []Rule{
+			{FromPath: "/a", Mode: ModeProxy, Upstreams: []string{down.URL}},
+		},
+	}
+
+	req, _ := http.NewRequest("GET", "http://localhost/a", nil)
+	rec := httptest.NewRecorder()
+	re.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected %d on total outage, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+}
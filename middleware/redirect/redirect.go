@@ -0,0 +1,336 @@
+// Package redirect is middleware for redirecting certain requests
+// to other locations.
+package redirect
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// Redirect is middleware to respond with HTTP redirects.
+type Redirect struct {
+	Next  middleware.Handler
+	Rules []Rule
+
+	// index, if non-nil, is a precompiled dispatcher over Rules built
+	// by NewRedirect. It finds an exact FromPath match with one map
+	// lookup instead of scanning every rule; see dispatcher for the
+	// tiers it still scans rule by rule. A Redirect built as a plain
+	// struct literal leaves this nil and falls back to an in-order
+	// linear scan.
+	index *dispatcher
+}
+
+// NewRedirect builds a Redirect backed by a precompiled dispatcher
+// over rules, suitable for large rule sets where a linear scan of
+// every rule per request would be too slow. See dispatcher for the
+// matching precedence it uses.
+func NewRedirect(next middleware.Handler, rules []Rule) *Redirect {
+	return &Redirect{
+		Next:  next,
+		Rules: rules,
+		index: newDispatcher(rules),
+	}
+}
+
+// ServeHTTP implements the middleware.Handler interface.
+func (rd Redirect) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	var rule *Rule
+	var to string
+	if rd.index != nil {
+		rule, to = rd.index.lookup(r)
+	} else {
+		rule, to = linearLookup(rd.Rules, r)
+	}
+	if rule == nil {
+		return rd.Next.ServeHTTP(w, r)
+	}
+	return rd.serve(w, r, rule, to)
+}
+
+// linearLookup scans rules in order and returns the first one that
+// matches r, along with its resolved redirect target. It implements
+// the original (pre-dispatcher) semantics: whichever rule comes first
+// in the slice wins.
+func linearLookup(rules []Rule, r *http.Request) (*Rule, string) {
+	scheme := reqScheme(r)
+	for i := range rules {
+		rule := &rules[i]
+		fromScheme := rule.FromScheme
+		if fromScheme == "" {
+			fromScheme = "http"
+		}
+		if fromScheme != scheme {
+			continue
+		}
+		if !hostMatches(rule.FromHost, r.Host) {
+			continue
+		}
+		if to, matched := rule.match(r); matched {
+			return rule, to
+		}
+	}
+	return nil, ""
+}
+
+// serve carries out the action called for by rule.Mode against a
+// request that has already matched it, resolving to to.
+func (rd Redirect) serve(w http.ResponseWriter, r *http.Request, rule *Rule, to string) (int, error) {
+	switch rule.mode() {
+	case ModeProxy:
+		status := rule.serveProxy(w, r)
+		redirectsTotal.WithLabelValues("proxy", strconv.Itoa(status), ruleID(*rule)).Inc()
+		return 0, nil
+
+	case ModeMeta:
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, metaRedir, to, to)
+		redirectsTotal.WithLabelValues("meta", strconv.Itoa(http.StatusOK), ruleID(*rule)).Inc()
+		return 0, nil
+
+	default:
+		code := rule.Code
+		if code == 0 {
+			code = http.StatusMovedPermanently
+		}
+		if (code == http.StatusTemporaryRedirect || code == http.StatusPermanentRedirect) &&
+			hasBody(r) && !sameOrigin(r, to) {
+			// 307/308 instruct the client to replay the method and body
+			// against Location; don't let that replay a request body to
+			// a different origin than the one it was submitted to.
+			code = http.StatusSeeOther
+		}
+		http.Redirect(w, r, to, code)
+		redirectsTotal.WithLabelValues("http", strconv.Itoa(code), ruleID(*rule)).Inc()
+		return 0, nil
+	}
+}
+
+// Redirect modes, selected by Rule.Mode.
+const (
+	ModeRedirect = "redirect" // respond with an HTTP 3xx redirect (the default)
+	ModeMeta     = "meta"     // respond with an HTML <meta> refresh
+	ModeProxy    = "proxy"    // transparently reverse-proxy to Upstreams/To
+)
+
+// Rule describes an HTTP redirect rule.
+type Rule struct {
+	FromScheme string
+	FromHost   string // hostname, optionally with ":port"; empty matches any Host
+	FromPath   string
+	FromRegex  string
+	To         string
+	Code       int // HTTP status for the redirect; 0 defaults to 301. 307/308 are downgraded to 303 for cross-origin requests with a body.
+	Meta       bool
+	Mode       string   // ModeRedirect, ModeMeta, or ModeProxy; "" defers to Meta for backwards compatibility
+	Upstreams  []string // base URLs to reverse-proxy to in ModeProxy, tried round-robin with retry
+
+	rrCounter uint32 // round-robin cursor for ModeProxy, advanced atomically
+}
+
+// mode returns the rule's effective redirect mode.
+func (rule Rule) mode() string {
+	switch rule.Mode {
+	case ModeMeta, ModeProxy:
+		return rule.Mode
+	default:
+		if rule.Meta {
+			return ModeMeta
+		}
+		return ModeRedirect
+	}
+}
+
+// match reports whether r satisfies the rule and, if so, returns the
+// redirect target with any regex capture groups and {uri}/{path}/{query}
+// placeholders substituted. A non-catch-all FromPath must match r's
+// path exactly; this is the original (pre-dispatcher) semantics.
+// Longest-prefix matching is a dispatcher-only behavior, implemented
+// independently by dispatcher.lookup's tier-2 logic.
+func (rule Rule) match(r *http.Request) (to string, matched bool) {
+	if rule.FromRegex != "" {
+		re, err := regexp.Compile(rule.FromRegex)
+		if err != nil {
+			return "", false
+		}
+		return rule.matchRegex(re, r)
+	}
+
+	if rule.FromPath != "/" && rule.FromPath != r.URL.Path {
+		return "", false
+	}
+	return rule.resolveTo(r), true
+}
+
+// matchRegex is like match's FromRegex branch, but against an already
+// compiled re instead of recompiling rule.FromRegex on every call. The
+// dispatcher uses this with a regex it precompiled once in
+// newDispatcher, rather than on every request.
+func (rule Rule) matchRegex(re *regexp.Regexp, r *http.Request) (to string, matched bool) {
+	loc := re.FindStringSubmatchIndex(r.URL.Path)
+	if loc == nil {
+		return "", false
+	}
+	expanded := string(re.ExpandString(nil, rule.To, r.URL.Path, loc))
+	return expandPlaceholders(r, expanded), true
+}
+
+// resolveTo expands rule.To's {uri}/{path}/{query}/{scheme}/{port}
+// placeholders against r. Unlike match, it doesn't check whether rule
+// applies to r; it's used by the dispatcher's literal-path tiers,
+// which have already established that by construction.
+func (rule Rule) resolveTo(r *http.Request) string {
+	return expandPlaceholders(r, rule.To)
+}
+
+// expandPlaceholders substitutes the {uri}, {path}, {query}, {scheme},
+// and {port} placeholders in s against r.
+func expandPlaceholders(r *http.Request, s string) string {
+	scheme := reqScheme(r)
+	_, port := splitHostPort(r.Host)
+	portSuffix := ""
+	if port != "" {
+		portSuffix = ":" + port
+	}
+
+	replacer := strings.NewReplacer(
+		"{uri}", r.URL.RequestURI(),
+		"{path}", r.URL.Path,
+		"{query}", r.URL.RawQuery,
+		"{scheme}", scheme,
+		"{port}", portSuffix,
+	)
+	return replacer.Replace(s)
+}
+
+// reqScheme returns the scheme of r: "https" if r arrived over TLS,
+// otherwise r.URL's scheme, defaulting to "http" when r.URL carries
+// none (as is the case for most server requests, since
+// http.Request.URL.Scheme is normally populated only for absolute
+// request targets or by a preceding proxy layer).
+func reqScheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	if r.URL.Scheme != "" {
+		return r.URL.Scheme
+	}
+	return "http"
+}
+
+// hasBody reports whether r carries a request body that a client
+// would replay against Location on a 307 or 308 redirect.
+func hasBody(r *http.Request) bool {
+	return r.ContentLength != 0 && r.Body != nil && r.Body != http.NoBody
+}
+
+// sameOrigin reports whether target shares scheme, host, and port
+// with the incoming request r. A relative target is always
+// same-origin, since it cannot name a different host.
+func sameOrigin(r *http.Request, target string) bool {
+	u, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+	if u.Host == "" {
+		return true
+	}
+	uHost, uPort := splitHostPort(u.Host)
+	rHost, rPort := splitHostPort(r.Host)
+	return u.Scheme == reqScheme(r) && uHost == rHost && uPort == rPort
+}
+
+// hostMatches reports whether reqHost satisfies ruleHost. An empty
+// ruleHost matches any host. If ruleHost specifies a port, reqHost
+// must carry the same port; otherwise only the hostnames are compared
+// and reqHost's port (if any) is ignored.
+func hostMatches(ruleHost, reqHost string) bool {
+	if ruleHost == "" {
+		return true
+	}
+	rHost, rPort := splitHostPort(ruleHost)
+	qHost, qPort := splitHostPort(reqHost)
+	if rHost != qHost {
+		return false
+	}
+	return rPort == "" || rPort == qPort
+}
+
+// splitHostPort splits hostport into its hostname and port. Unlike
+// net.SplitHostPort, it tolerates a bare hostname (or any value with
+// no colon) by returning it as the host with an empty port, instead
+// of an error.
+func splitHostPort(hostport string) (host, port string) {
+	if h, p, err := net.SplitHostPort(hostport); err == nil {
+		return h, p
+	}
+	return hostport, ""
+}
+
+// ForceHTTPS returns a Rule that redirects plain-HTTP requests for
+// host to the HTTPS equivalent, preserving the request's path, query,
+// and port.
+func ForceHTTPS(host string) Rule {
+	return Rule{
+		FromScheme: "http",
+		FromHost:   host,
+		FromPath:   "/",
+		To:         "https://" + host + "{port}{uri}",
+		Code:       http.StatusMovedPermanently,
+	}
+}
+
+// StripWWW returns the Rules needed to redirect "www."+host to the
+// bare apex domain on both HTTP and HTTPS, preserving scheme, path,
+// query, and port.
+func StripWWW(host string) []Rule {
+	to := "{scheme}://" + host + "{port}{uri}"
+	return []Rule{
+		{FromScheme: "http", FromHost: "www." + host, FromPath: "/", To: to, Code: http.StatusMovedPermanently},
+		{FromScheme: "https", FromHost: "www." + host, FromPath: "/", To: to, Code: http.StatusMovedPermanently},
+	}
+}
+
+// AddWWW returns the Rules needed to redirect the apex domain host to
+// its "www." subdomain on both HTTP and HTTPS, preserving scheme,
+// path, query, and port.
+func AddWWW(host string) []Rule {
+	to := "{scheme}://www." + host + "{port}{uri}"
+	return []Rule{
+		{FromScheme: "http", FromHost: host, FromPath: "/", To: to, Code: http.StatusMovedPermanently},
+		{FromScheme: "https", FromHost: host, FromPath: "/", To: to, Code: http.StatusMovedPermanently},
+	}
+}
+
+// HTTPSAndWWW returns the Rules needed to canonicalize every variant
+// of host (http or https, apex or "www.") to "https://www."+host in
+// one step, preserving path, query, and port.
+func HTTPSAndWWW(host string) []Rule {
+	canonical := "https://www." + host
+	to := canonical + "{port}{uri}"
+	return []Rule{
+		{FromScheme: "http", FromHost: host, FromPath: "/", To: to, Code: http.StatusMovedPermanently},
+		{FromScheme: "http", FromHost: "www." + host, FromPath: "/", To: to, Code: http.StatusMovedPermanently},
+		{FromScheme: "https", FromHost: host, FromPath: "/", To: to, Code: http.StatusMovedPermanently},
+	}
+}
+
+// metaRedir is the HTML served for "Meta" redirects, which redirect
+// via a <meta> refresh tag rather than an HTTP 3xx status, for clients
+// that don't follow HTTP redirects (or to preserve a 200 status).
+const metaRedir = `<!DOCTYPE html>
+<html>
+	<head>
+		<title>Moved</title>
+		<meta http-equiv="refresh" content="0; URL='%s'">
+	</head>
+	<body><h1>Moved</h1><a href="%s">Click here to continue</a>.</body>
+</html>
+`
@@ -3,6 +3,7 @@ package redirect
 import (
 	"bytes"
 	"crypto/tls"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -113,6 +114,253 @@ func TestParametersRedirect(t *testing.T) {
 	}
 }
 
+func TestRegexRedirect(t *testing.T) {
+	for i, test := range []struct {
+		from             string
+		rule             Rule
+		expectedLocation string
+		expectedCode     int
+	}{
+		{
+			from:             "http://localhost/products/42/widgets?color=red",
+			rule:             Rule{FromRegex: `^/products/(\d+)/(.*)$`, To: "/p/$1/{query}", Code: http.StatusMovedPermanently},
+			expectedLocation: "/p/42/color=red",
+			expectedCode:     http.StatusMovedPermanently,
+		},
+		{
+			// non-matching path falls through to Next
+			from:             "http://localhost/products/abc/widgets",
+			rule:             Rule{FromRegex: `^/products/(\d+)/(.*)$`, To: "/p/$1/$2", Code: http.StatusMovedPermanently},
+			expectedLocation: "",
+			expectedCode:     http.StatusOK,
+		},
+		{
+			// FromScheme restricts the regex rule just like a literal one
+			from:             "https://localhost/products/42/widgets",
+			rule:             Rule{FromScheme: "http", FromRegex: `^/products/(\d+)/(.*)$`, To: "/p/$1/$2", Code: http.StatusMovedPermanently},
+			expectedLocation: "",
+			expectedCode:     http.StatusOK,
+		},
+	} {
+		var nextCalled bool
+
+		re := Redirect{
+			Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+				nextCalled = true
+				return 0, nil
+			}),
+			Rules: []Rule{test.rule},
+		}
+
+		req, err := http.NewRequest("GET", test.from, nil)
+		if err != nil {
+			t.Fatalf("Test %d: Could not create HTTP request: %v", i, err)
+		}
+		if strings.HasPrefix(test.from, "https://") {
+			req.TLS = new(tls.ConnectionState) // faux HTTPS
+		}
+
+		rec := httptest.NewRecorder()
+		re.ServeHTTP(rec, req)
+
+		if rec.Header().Get("Location") != test.expectedLocation {
+			t.Errorf("Test %d: Expected Location header to be %q but was %q",
+				i, test.expectedLocation, rec.Header().Get("Location"))
+		}
+
+		if rec.Code != test.expectedCode {
+			t.Errorf("Test %d: Expected status code to be %d but was %d",
+				i, test.expectedCode, rec.Code)
+		}
+
+		if nextCalled && test.expectedLocation != "" {
+			t.Errorf("Test %d: Next handler was unexpectedly called", i)
+		}
+	}
+}
+
+func TestRegexMetaRedirect(t *testing.T) {
+	re := Redirect{
+		Rules: []Rule{
+			{FromRegex: `^/articles/(\d+)$`, Meta: true, To: "/blog/$1"},
+		},
+	}
+
+	req, err := http.NewRequest("GET", "http://localhost/articles/7", nil)
+	if err != nil {
+		t.Fatalf("Could not create HTTP request: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	re.ServeHTTP(rec, req)
+
+	body, err := ioutil.ReadAll(rec.Body)
+	if err != nil {
+		t.Fatalf("Could not read HTTP response body: %v", err)
+	}
+	expectedSnippet := `<meta http-equiv="refresh" content="0; URL='/blog/7'">`
+	if !bytes.Contains(body, []byte(expectedSnippet)) {
+		t.Errorf("Expected Response Body to contain %q but was %q", expectedSnippet, body)
+	}
+}
+
+func TestHostRedirect(t *testing.T) {
+	for i, test := range []struct {
+		host             string
+		rule             Rule
+		expectedLocation string
+		expectedCode     int
+	}{
+		{
+			host:             "example.com",
+			rule:             Rule{FromHost: "example.com", FromPath: "/a", To: "/b", Code: http.StatusMovedPermanently},
+			expectedLocation: "/b",
+			expectedCode:     http.StatusMovedPermanently,
+		},
+		{
+			// Host header carries a port; FromHost has none, so only the
+			// hostname is compared.
+			host:             "example.com:8080",
+			rule:             Rule{FromHost: "example.com", FromPath: "/a", To: "/b", Code: http.StatusMovedPermanently},
+			expectedLocation: "/b",
+			expectedCode:     http.StatusMovedPermanently,
+		},
+		{
+			// FromHost pins a port the request doesn't carry.
+			host:             "example.com",
+			rule:             Rule{FromHost: "example.com:8080", FromPath: "/a", To: "/b", Code: http.StatusMovedPermanently},
+			expectedLocation: "",
+			expectedCode:     http.StatusOK,
+		},
+		{
+			host:             "other.com",
+			rule:             Rule{FromHost: "example.com", FromPath: "/a", To: "/b", Code: http.StatusMovedPermanently},
+			expectedLocation: "",
+			expectedCode:     http.StatusOK,
+		},
+	} {
+		re := Redirect{
+			Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+				return 0, nil
+			}),
+			Rules: []Rule{test.rule},
+		}
+
+		req, err := http.NewRequest("GET", "http://"+test.host+"/a", nil)
+		if err != nil {
+			t.Fatalf("Test %d: Could not create HTTP request: %v", i, err)
+		}
+		req.Host = test.host
+
+		rec := httptest.NewRecorder()
+		re.ServeHTTP(rec, req)
+
+		if rec.Header().Get("Location") != test.expectedLocation {
+			t.Errorf("Test %d: Expected Location header to be %q but was %q",
+				i, test.expectedLocation, rec.Header().Get("Location"))
+		}
+		if rec.Code != test.expectedCode {
+			t.Errorf("Test %d: Expected status code to be %d but was %d",
+				i, test.expectedCode, rec.Code)
+		}
+	}
+}
+
+func TestCanonicalHostHelpers(t *testing.T) {
+	for i, test := range []struct {
+		rules            []Rule
+		url              string
+		host             string
+		expectedLocation string
+	}{
+		{[]Rule{ForceHTTPS("example.com")}, "http://example.com/a?b=c", "example.com", "https://example.com/a?b=c"},
+		{[]Rule{ForceHTTPS("example.com")}, "http://example.com:8080/a", "example.com:8080", "https://example.com:8080/a"},
+		{StripWWW("example.com"), "http://www.example.com/a", "www.example.com", "http://example.com/a"},
+		{StripWWW("example.com"), "https://www.example.com/a", "www.example.com", "https://example.com/a"},
+		{AddWWW("example.com"), "http://example.com/a", "example.com", "http://www.example.com/a"},
+		{AddWWW("example.com"), "https://example.com/a", "example.com", "https://www.example.com/a"},
+	} {
+		re := Redirect{
+			Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+				return 0, nil
+			}),
+			Rules: test.rules,
+		}
+
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatalf("Test %d: Could not create HTTP request: %v", i, err)
+		}
+		req.Host = test.host
+
+		rec := httptest.NewRecorder()
+		re.ServeHTTP(rec, req)
+
+		if rec.Header().Get("Location") != test.expectedLocation {
+			t.Errorf("Test %d: Expected Location header to be %q but was %q",
+				i, test.expectedLocation, rec.Header().Get("Location"))
+		}
+	}
+}
+
+func TestSplitHostPortNoPanic(t *testing.T) {
+	for _, hostport := range []string{"", "example.com", "[::1]", "example.com:", ":8080", "example.com:8080"} {
+		host, port := splitHostPort(hostport)
+		_ = host
+		_ = port // only verifying splitHostPort does not panic on malformed input
+	}
+
+	if !hostMatches("", "anything") {
+		t.Error("Expected empty FromHost to match any Host value")
+	}
+	if hostMatches("example.com", "") {
+		t.Error("Expected non-empty FromHost not to match an empty Host value")
+	}
+}
+
+func TestBodySafeStatusCode(t *testing.T) {
+	for i, test := range []struct {
+		method       string
+		code         int
+		to           string
+		withBody     bool
+		expectedCode int
+	}{
+		// cross-origin POST with a body on 308 is downgraded to 303
+		{"POST", http.StatusPermanentRedirect, "http://other.com/b", true, http.StatusSeeOther},
+		// same-origin POST with a body preserves 308
+		{"POST", http.StatusPermanentRedirect, "http://localhost/b", true, http.StatusPermanentRedirect},
+		// same-origin POST with a body preserves 307
+		{"POST", http.StatusTemporaryRedirect, "http://localhost/b", true, http.StatusTemporaryRedirect},
+		// GET requests carry no body, so the code is unaffected even cross-origin
+		{"GET", http.StatusPermanentRedirect, "http://other.com/b", false, http.StatusPermanentRedirect},
+		// a relative target is always same-origin
+		{"POST", http.StatusPermanentRedirect, "/b", true, http.StatusPermanentRedirect},
+	} {
+		re := Redirect{
+			Rules: []Rule{
+				{FromPath: "/a", To: test.to, Code: test.code},
+			},
+		}
+
+		var body io.Reader
+		if test.withBody {
+			body = strings.NewReader("field=value")
+		}
+		req, err := http.NewRequest(test.method, "http://localhost/a", body)
+		if err != nil {
+			t.Fatalf("Test %d: Could not create HTTP request: %v", i, err)
+		}
+
+		rec := httptest.NewRecorder()
+		re.ServeHTTP(rec, req)
+
+		if rec.Code != test.expectedCode {
+			t.Errorf("Test %d: Expected status code %d but was %d", i, test.expectedCode, rec.Code)
+		}
+	}
+}
+
 func TestMetaRedirect(t *testing.T) {
 	re := Redirect{
 		Rules: []Rule{